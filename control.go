@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// serveControlAPI runs the status/control HTTP API on p.ControlListen
+// until the process exits (or the listener fails). Routes:
+//
+//	GET  /status            status of every connection and tunnel, as JSON
+//	POST /reconnect/{name}  force-reconnect one connection
+//	POST /reload            re-read the config file and diff-apply it
+//	GET  /metrics           Prometheus exposition format
+func (p *program) serveControlAPI() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", p.handleStatus)
+	mux.HandleFunc("/reconnect/", p.handleReconnect)
+	mux.HandleFunc("/reload", p.handleReload)
+	mux.HandleFunc("/metrics", p.handleMetrics)
+
+	log.Println("control API listening on " + p.ControlListen)
+	if err := http.ListenAndServe(p.ControlListen, mux); err != nil {
+		log.Println("control API stopped: " + err.Error())
+	}
+}
+
+type tunnelStatus struct {
+	From            Endpoint `json:"From"`
+	To              Endpoint `json:"To"`
+	ActiveConns     int32    `json:"ActiveConns"`
+	BytesFromClient int64    `json:"BytesFromClient"`
+	BytesToClient   int64    `json:"BytesToClient"`
+}
+
+type connectionStatus struct {
+	Name           string         `json:"Name"`
+	Status         string         `json:"Status"`
+	Connected      bool           `json:"Connected"`
+	UptimeSeconds  float64        `json:"UptimeSeconds"`
+	ReconnectDelay string         `json:"ReconnectDelay"`
+	Tunnels        []tunnelStatus `json:"Tunnels"`
+}
+
+// buildStatus snapshots c's status for /status and /metrics. Named
+// buildStatus, not status, since Connection already has a status field.
+func (c *Connection) buildStatus() connectionStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	connected := c.conn != nil
+	var uptime float64
+	if connectedAt, ok := c.connectedAt.Load().(time.Time); ok && connected {
+		uptime = time.Since(connectedAt).Seconds()
+	}
+
+	tunnels := make([]tunnelStatus, len(c.Tunnels))
+	for i, t := range c.Tunnels {
+		tunnels[i] = tunnelStatus{
+			From:            t.From,
+			To:              t.To,
+			ActiveConns:     t.activeConns.Load(),
+			BytesFromClient: t.bytesFromClient.Load(),
+			BytesToClient:   t.bytesToClient.Load(),
+		}
+	}
+
+	return connectionStatus{
+		Name:           c.Name,
+		Status:         c.getStatus(),
+		Connected:      connected,
+		UptimeSeconds:  uptime,
+		ReconnectDelay: c.reconnectDelay.String(),
+		Tunnels:        tunnels,
+	}
+}
+
+// config returns a snapshot of p.Config, safe to range over without
+// racing reload(), which replaces the slice wholesale.
+func (p *program) config() []*Connection {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.Config
+}
+
+func (p *program) handleStatus(w http.ResponseWriter, r *http.Request) {
+	config := p.config()
+	statuses := make([]connectionStatus, len(config))
+	for i, c := range config {
+		statuses[i] = c.buildStatus()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statuses)
+}
+
+func (p *program) handleReconnect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/reconnect/")
+	for _, c := range p.config() {
+		if c.Name == name {
+			c.requestReconnect()
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	http.Error(w, "no such connection "+name, http.StatusNotFound)
+}
+
+func (p *program) handleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := p.reload(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *program) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	fmt.Fprintln(w, "# HELP tuntun_connection_up Whether a connection's SSH session is currently established.")
+	fmt.Fprintln(w, "# TYPE tuntun_connection_up gauge")
+
+	config := p.config()
+	statuses := make([]connectionStatus, len(config))
+	for i, c := range config {
+		statuses[i] = c.buildStatus()
+	}
+	for _, s := range statuses {
+		up := 0
+		if s.Connected {
+			up = 1
+		}
+		fmt.Fprintf(w, "tuntun_connection_up{connection=%q} %d\n", s.Name, up)
+	}
+
+	fmt.Fprintln(w, "# HELP tuntun_tunnel_active_connections Currently open connections being forwarded by a tunnel.")
+	fmt.Fprintln(w, "# TYPE tuntun_tunnel_active_connections gauge")
+	fmt.Fprintln(w, "# HELP tuntun_tunnel_bytes_from_client_total Bytes forwarded from whoever connects to a tunnel's From side.")
+	fmt.Fprintln(w, "# TYPE tuntun_tunnel_bytes_from_client_total counter")
+	fmt.Fprintln(w, "# HELP tuntun_tunnel_bytes_to_client_total Bytes forwarded back to whoever connects to a tunnel's From side.")
+	fmt.Fprintln(w, "# TYPE tuntun_tunnel_bytes_to_client_total counter")
+	for _, s := range statuses {
+		for _, t := range s.Tunnels {
+			labels := fmt.Sprintf("connection=%q,from=%q,to=%q", s.Name, t.From.Address, t.To.Address)
+			fmt.Fprintf(w, "tuntun_tunnel_active_connections{%s} %d\n", labels, t.ActiveConns)
+			fmt.Fprintf(w, "tuntun_tunnel_bytes_from_client_total{%s} %d\n", labels, t.BytesFromClient)
+			fmt.Fprintf(w, "tuntun_tunnel_bytes_to_client_total{%s} %d\n", labels, t.BytesToClient)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// hostKeyCallback builds the ssh.HostKeyCallback for c: Fingerprint and
+// Fingerprints take priority, for backward compatibility and for
+// connections that would rather pin a key than manage a known_hosts
+// file; otherwise, c.KnownHostsFile is checked, with unknown hosts
+// trusted and recorded if c.TrustOnFirstUse is set.
+func (c *Connection) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	fingerprints := c.Fingerprints
+	if c.Fingerprint != "" {
+		fingerprints = append([]string{c.Fingerprint}, fingerprints...)
+	}
+	if len(fingerprints) > 0 {
+		return fingerprintsCallback(fingerprints), nil
+	}
+
+	if c.KnownHostsFile == "" {
+		return nil, fmt.Errorf("no Fingerprint, Fingerprints, or KnownHostsFile configured for connection " + c.Name)
+	}
+
+	// knownhosts.New requires the file to exist; an absent file is
+	// equivalent to one with no entries, as long as TrustOnFirstUse can
+	// still create it below.
+	if _, err := os.Stat(c.KnownHostsFile); os.IsNotExist(err) {
+		if !c.TrustOnFirstUse {
+			return nil, fmt.Errorf("known_hosts file %s does not exist and TrustOnFirstUse is not set", c.KnownHostsFile)
+		}
+		if err := os.WriteFile(c.KnownHostsFile, nil, 0600); err != nil {
+			return nil, fmt.Errorf("failed to create known_hosts file %s: %w", c.KnownHostsFile, err)
+		}
+	}
+
+	knownHostsCallback, err := knownhosts.New(c.KnownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read known_hosts file %s: %w", c.KnownHostsFile, err)
+	}
+
+	if !c.TrustOnFirstUse {
+		return knownHostsCallback, nil
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := knownHostsCallback(hostname, remote, key)
+		if err == nil {
+			return nil
+		}
+
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) || len(keyErr.Want) > 0 {
+			// either the host is known but its key has changed, or
+			// knownHostsCallback failed for some other reason (e.g. a
+			// revoked key, or a malformed hostname): never silently
+			// trust this, TOFU or not
+			return fmt.Errorf("refusing to connect to %s: %w", hostname, err)
+		}
+
+		// keyErr.Want is empty: the host has no entry at all. Trust and
+		// remember it.
+		return appendKnownHost(c.KnownHostsFile, hostname, key)
+	}, nil
+}
+
+func appendKnownHost(path, hostname string, key ssh.PublicKey) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	line := knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key)
+	_, err = f.WriteString(line + "\n")
+	return err
+}
+
+// fingerprintsCallback accepts a server whose host key's fingerprint
+// matches any of fingerprints, each either a "SHA256:..." or
+// "MD5:aa:bb:..." fingerprint (matching ssh-keygen -l output), or a bare
+// legacy MD5 fingerprint for compatibility with older configs.
+func fingerprintsCallback(fingerprints []string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		for _, want := range fingerprints {
+			if fingerprintMatches(want, key) {
+				return nil
+			}
+		}
+		return fmt.Errorf(
+			"host key fingerprint %s (%s) for %s does not match any configured fingerprint",
+			ssh.FingerprintSHA256(key), ssh.FingerprintLegacyMD5(key), hostname,
+		)
+	}
+}
+
+func fingerprintMatches(want string, key ssh.PublicKey) bool {
+	switch {
+	case strings.HasPrefix(want, "SHA256:"):
+		return want == ssh.FingerprintSHA256(key)
+	case strings.HasPrefix(want, "MD5:"):
+		return strings.TrimPrefix(want, "MD5:") == ssh.FingerprintLegacyMD5(key)
+	default:
+		return want == ssh.FingerprintLegacyMD5(key)
+	}
+}
@@ -1,50 +1,216 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
 	"net"
+	"net/url"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/9072997/fingerprintverifier"
 	"github.com/kardianos/service"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
 )
 
 type Connection struct {
-	Name              string
-	Host              string
-	Username          string
-	KeyFile           string
-	Key               string
-	Password          string
-	Fingerprint       string
+	Name        string
+	Host        string
+	Username    string
+	KeyFile     string
+	Key         string
+	Password    string
+	Fingerprint string
+
+	// Transport is how the TCP-like byte stream carrying SSH is
+	// obtained: "tcp" (default), or "ws"/"wss" to tunnel it over a
+	// WebSocket to a "tuntun serve-ws" companion listener, for
+	// traversing proxies that only allow HTTP(S) out. When set to
+	// "ws"/"wss", Host is a WebSocket URL (e.g.
+	// "wss://relay.example.com/tunnel") rather than a host:port.
+	Transport string
+
+	// Fingerprints holds additional acceptable host key fingerprints
+	// beyond the legacy Fingerprint field; a server matching any one of
+	// them is accepted. Ignored once KnownHostsFile is used instead (see
+	// below).
+	Fingerprints []string
+
+	// KnownHostsFile and TrustOnFirstUse are used only when neither
+	// Fingerprint nor Fingerprints is set; HostKeyAlgorithms, if set,
+	// restricts the accepted host key algorithms in every case.
+	// KnownHostsFile defaults to a known_hosts file next to the config
+	// file. If
+	// TrustOnFirstUse is set, an unknown server's key is recorded there
+	// on first connect instead of being refused; a known host whose key
+	// has since changed, or whose key is marked @revoked, is always
+	// refused, TrustOnFirstUse or not.
+	//
+	// Upgrade note: connections that relied on the old fingerprint-less
+	// default (connect with a warning, no verification) now refuse to
+	// connect until one of Fingerprint, Fingerprints, or
+	// TrustOnFirstUse is configured, or KnownHostsFile already holds
+	// the server's key.
+	KnownHostsFile    string
+	HostKeyAlgorithms []string
+	TrustOnFirstUse   bool
+
+	// Keys holds additional keys beyond KeyFile/Key, each with its own
+	// optional passphrase. Every key (legacy and here) that parses
+	// successfully is offered via a single ssh.PublicKeys auth method.
+	Keys []KeyConfig
+
+	// AgentSocket, if set, overrides the SSH_AUTH_SOCK environment
+	// variable as the path to an ssh-agent socket to authenticate
+	// through.
+	AgentSocket string
+
+	// KeyboardInteractive answers keyboard-interactive prompts whose
+	// text contains one of these keys (e.g. "Password", "Verification
+	// code") with the corresponding value, for servers that require
+	// AuthenticationMethods publickey,keyboard-interactive or similar.
+	KeyboardInteractive map[string]string
+
 	KeepAliveInterval Duration
 	MaxReconnectDelay Duration
 	Tunnels           []*Tunnel
 
 	// internal fields
 	status         atomic.Value
-	auth           ssh.AuthMethod
-	conn           *ssh.Client
-	listeners      []net.Listener
+	authMethods    []ssh.AuthMethod
 	reconnectDelay time.Duration
+	connectedAt    atomic.Value // time.Time
+	forceReconnect chan struct{}
+
+	// done, closed by remove, tells Handle to close c down and return
+	// instead of reconnecting, used when /reload drops c from the config.
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// mu guards conn, listeners, and Tunnels, which Handle mutates every
+	// reconnect cycle and the control API mutates from /reload and
+	// /reload's reloadTunnels, from a different goroutine.
+	mu        sync.Mutex
+	conn      *ssh.Client
+	listeners []net.Listener
 }
 
 type Tunnel struct {
 	From Endpoint
 	To   Endpoint
 
+	// Allow and Deny restrict which destinations a Dynamic (SOCKS5)
+	// tunnel may reach. Each pattern is matched against "host:port" with
+	// path.Match. Deny is checked first; if Allow is non-empty, a
+	// destination must also match one of its patterns.
+	Allow []string
+	Deny  []string
+
 	// internal fields
 	direction TunnelDirection
+	listener  net.Listener
+
+	// bytesFromClient/bytesToClient count bytes crossing the tunnel
+	// relative to whoever connects to the From side: a client
+	// connecting to a Local listener, or a peer connecting to a Remote
+	// listener. Read by the control API's /status and /metrics.
+	bytesFromClient atomic.Int64
+	bytesToClient   atomic.Int64
+	activeConns     atomic.Int32
 }
 
 type Endpoint struct {
 	Side    string
 	Address string
+	Network string // "tcp" (default), "unix", or "npipe" (Windows only)
+	Mode    string // optional permissions (e.g. "0660") for a Local unix socket; ignored for npipe
+}
+
+// validate normalizes e.Network and checks e.Address against it, returning
+// a description of the problem (without mentioning the connection or
+// tunnel it belongs to) or "" if e is fine.
+func (e *Endpoint) validate() string {
+	if e.Network == "" {
+		e.Network = "tcp"
+	}
+
+	switch e.Network {
+	case "tcp":
+		_, port, err := net.SplitHostPort(e.Address)
+		if err != nil {
+			return "address is invalid: " + err.Error()
+		}
+		if port == "" {
+			return "address is missing port number"
+		}
+	case "unix", "npipe":
+		if e.Address == "" {
+			return "address is empty"
+		}
+		if filepath.IsAbs(e.Address) == false && runtime.GOOS != "windows" {
+			return "address must be an absolute path for network " + e.Network
+		}
+	default:
+		return "network must be tcp, unix, or npipe, not " + e.Network
+	}
+
+	return ""
+}
+
+// classifyTunnel normalizes and validates t (setting t.direction) and
+// returns a description of the problem (without mentioning the
+// connection it belongs to) or "" if t is fine. Used by both
+// Connection.validate and /reload, so a reloaded tunnel is classified
+// exactly like one that came up with its connection.
+func classifyTunnel(t *Tunnel) string {
+	if t.From.Side == "" {
+		return "From.Side is empty"
+	}
+	if t.From.Address == "" {
+		return "From.Address is empty"
+	}
+	if t.To.Side == "" {
+		return "To.Side is empty"
+	}
+	if t.To.Address == "" {
+		return "To.Address is empty"
+	}
+
+	// tunnel must have a Local and Remote endpoint, except a Dynamic
+	// (SOCKS5) tunnel, which has no fixed To and is recognized by
+	// To.Address being the magic value "socks5"
+	if t.From.Side == "Local" && t.To.Side == "Remote" && t.To.Address == dynamicToAddress {
+		t.direction = Dynamic
+	} else if t.From.Side == "Local" && t.To.Side == "Remote" {
+		t.direction = ExposedLocally
+	} else if t.From.Side == "Remote" && t.To.Side == "Local" {
+		t.direction = ExposedOnServer
+	} else {
+		return "tunnel should be Local->Remote or Remote->Local"
+	}
+
+	if issue := t.From.validate(); issue != "" {
+		return "tunnel From " + issue
+	}
+	if t.direction != Dynamic {
+		if issue := t.To.validate(); issue != "" {
+			return "tunnel To " + issue
+		}
+	}
+
+	// only a Local endpoint can be a named pipe or unix socket that we
+	// listen on; the ssh package handles dialing/listening the other
+	// side over the tunnel itself
+	if t.From.Network == "npipe" && t.From.Side != "Local" {
+		return "npipe endpoints are only supported as Local"
+	}
+
+	return ""
 }
 
 type TunnelDirection int
@@ -53,10 +219,30 @@ const (
 	UnspecifiedDirection TunnelDirection = iota
 	ExposedOnServer
 	ExposedLocally
+	// Dynamic turns the Local endpoint into a SOCKS5 proxy that dials
+	// whatever destination each client connection requests, instead of
+	// a fixed To address. Selected by setting To.Address to "socks5".
+	Dynamic
 )
 
+// dynamicToAddress is the magic To.Address that selects a Dynamic
+// (SOCKS5) tunnel instead of a fixed Local<->Remote forward.
+const dynamicToAddress = "socks5"
+
 type program struct {
+	// mu guards Config and ControlListen, which reload() replaces from
+	// the control API's HTTP handler goroutine while the other handlers
+	// read them concurrently.
+	mu     sync.Mutex
 	Config []*Connection
+
+	// ControlListen, if set, is the address the control/status HTTP API
+	// (see control.go) listens on, e.g. "127.0.0.1:7337".
+	ControlListen string
+
+	// configPath is remembered so /reload can re-read the same file
+	// Start did.
+	configPath string
 }
 
 func main() {
@@ -83,6 +269,9 @@ func main() {
 				panic(err)
 			}
 			return
+		case "serve-ws":
+			runServeWS(os.Args[2:])
+			return
 		}
 	}
 
@@ -94,15 +283,17 @@ func main() {
 
 func (p *program) Start(s service.Service) error {
 	// read config file
-	path := GetConfigPath()
-	j, err := os.ReadFile(path)
+	p.configPath = GetConfigPath()
+	j, err := os.ReadFile(p.configPath)
 	if err != nil {
 		return fmt.Errorf("failed to read config file: %w", err)
 	}
-	err = json.Unmarshal(j, &p.Config)
+	parsed, err := parseConfigFile(j)
 	if err != nil {
 		return fmt.Errorf("failed to parse config file: %w", err)
 	}
+	p.Config = parsed.Connections
+	p.ControlListen = parsed.ControlListen
 
 	// validate config
 	if len(p.Config) == 0 {
@@ -120,6 +311,10 @@ func (p *program) Start(s service.Service) error {
 		go Handle(c)
 	}
 
+	if p.ControlListen != "" {
+		go p.serveControlAPI()
+	}
+
 	return nil
 }
 
@@ -128,6 +323,60 @@ func (p *program) Stop(s service.Service) error {
 	return nil
 }
 
+// reload re-reads the config file and diff-applies it: connections
+// added are connected, connections removed are closed, and connections
+// present in both keep their live *ssh.Client (see
+// Connection.reloadTunnels for the same treatment of tunnels within an
+// unaffected connection). Used by the control API's POST /reload.
+func (p *program) reload() error {
+	j, err := os.ReadFile(p.configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	parsed, err := parseConfigFile(j)
+	if err != nil {
+		return fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	existing := make(map[string]*Connection, len(p.Config))
+	for _, c := range p.Config {
+		existing[c.Name] = c
+	}
+
+	newConfig := make([]*Connection, 0, len(parsed.Connections))
+	keep := make(map[string]bool, len(parsed.Connections))
+	for _, wanted := range parsed.Connections {
+		keep[wanted.Name] = true
+
+		if c, ok := existing[wanted.Name]; ok {
+			if err := c.reloadTunnels(wanted.Tunnels); err != nil {
+				return fmt.Errorf("connection %s: %w", wanted.Name, err)
+			}
+			newConfig = append(newConfig, c)
+			continue
+		}
+
+		if issue := wanted.validate(); issue != "" {
+			return fmt.Errorf("invalid config for new connection %s: %s", wanted.Name, issue)
+		}
+		newConfig = append(newConfig, wanted)
+		go Handle(wanted)
+	}
+
+	for name, c := range existing {
+		if !keep[name] {
+			c.remove()
+		}
+	}
+
+	p.Config = newConfig
+	p.ControlListen = parsed.ControlListen
+	return nil
+}
+
 func (c *Connection) setStatus(status string) {
 	log.Println(c.Name + ": " + status)
 	c.status.Store(status)
@@ -141,6 +390,104 @@ func (c *Connection) getStatus() string {
 	return s.(string)
 }
 
+// requestReconnect asks Handle to force-reconnect c the next time it's
+// idle, used by the control API's /reconnect/{name}. It's non-blocking:
+// a request already pending is left as-is.
+func (c *Connection) requestReconnect() {
+	select {
+	case c.forceReconnect <- struct{}{}:
+	default:
+	}
+}
+
+// remove asks Handle to close c down and stop, used by /reload when c
+// is dropped from the config. Safe to call more than once.
+func (c *Connection) remove() {
+	c.closeOnce.Do(func() { close(c.done) })
+}
+
+// KeyConfig is one key to offer during public-key authentication. File
+// and Key are mutually exclusive, like Connection's legacy KeyFile/Key
+// fields; Password, if set, is the passphrase for an encrypted key.
+type KeyConfig struct {
+	File     string
+	Key      string
+	Password string
+}
+
+// parse reads and decrypts k, returning the resulting signer. If k is
+// entirely empty (no File or Key set) it returns (nil, ""): not an
+// error, just nothing to offer. connName is only used to build error
+// messages.
+func (k *KeyConfig) parse(connName string) (ssh.Signer, string) {
+	if k.File != "" && k.Key != "" {
+		return nil, "connection " + connName + " has a key with both File and Key set"
+	}
+
+	var key []byte
+	if k.File != "" {
+		b, err := os.ReadFile(k.File)
+		if err != nil {
+			return nil, "failed to read key file " + k.File + " for connection " + connName + ": " + err.Error()
+		}
+		key = b
+	} else if k.Key != "" {
+		key = []byte(k.Key)
+	} else {
+		return nil, ""
+	}
+
+	var signer ssh.Signer
+	var err error
+	if k.Password == "" {
+		signer, err = ssh.ParsePrivateKey(key)
+	} else {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(k.Password))
+	}
+	if err != nil {
+		return nil, "failed to parse key for connection " + connName + ": " + err.Error()
+	}
+
+	return signer, ""
+}
+
+// agentAuthMethod returns an auth method backed by an ssh-agent at
+// c.AgentSocket (or SSH_AUTH_SOCK if that's unset), or (nil, nil) if
+// neither is set.
+func (c *Connection) agentAuthMethod() (ssh.AuthMethod, error) {
+	sock := c.AgentSocket
+	if sock == "" {
+		sock = os.Getenv("SSH_AUTH_SOCK")
+	}
+	if sock == "" {
+		return nil, nil
+	}
+
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to agent socket %s: %w", sock, err)
+	}
+
+	return ssh.PublicKeysCallback(agent.NewClient(conn).Signers), nil
+}
+
+// keyboardInteractiveChallenge answers each question in a
+// keyboard-interactive exchange by matching it against the keys of
+// c.KeyboardInteractive (e.g. a question containing "Verification code"
+// is answered with c.KeyboardInteractive["Verification code"]).
+func (c *Connection) keyboardInteractiveChallenge(name, instruction string, questions []string, echos []bool) ([]string, error) {
+	answers := make([]string, len(questions))
+	for i, question := range questions {
+		for prompt, answer := range c.KeyboardInteractive {
+			if strings.Contains(question, prompt) {
+				answers[i] = answer
+				break
+			}
+		}
+	}
+	return answers, nil
+}
+
 func (c *Connection) validate() string {
 	if c.Name == "" {
 		return "connection has no name"
@@ -160,95 +507,92 @@ func (c *Connection) validate() string {
 	if c.MaxReconnectDelay.Unwrap() == 0 {
 		c.MaxReconnectDelay.Set(time.Minute)
 	}
+	if c.forceReconnect == nil {
+		c.forceReconnect = make(chan struct{}, 1)
+	}
+	if c.done == nil {
+		c.done = make(chan struct{})
+	}
 
 	// KeyFile and Key are mutually exclusive
 	if c.KeyFile != "" && c.Key != "" {
 		return "connection " + c.Name + " has both KeyFile and Key set"
 	}
 
-	// check that Host resolves
-	host, _, err := net.SplitHostPort(c.Host)
-	if err != nil {
-		// default to port 22
-		host = c.Host
-		c.Host = net.JoinHostPort(c.Host, "22")
-	}
-	addrs, _ := net.LookupHost(host)
-	if len(addrs) == 0 {
-		return "failed to resolve host " + c.Host + " for connection " + c.Name
+	if c.KnownHostsFile == "" {
+		c.KnownHostsFile = filepath.Join(filepath.Dir(GetConfigPath()), "known_hosts")
 	}
 
-	// try to read key (if set)
-	var key []byte
-	if c.KeyFile != "" {
-		var err error
-		key, err = os.ReadFile(c.KeyFile)
+	switch c.Transport {
+	case "", "tcp":
+		// check that Host resolves
+		host, _, err := net.SplitHostPort(c.Host)
 		if err != nil {
-			return "failed to read key file " + c.KeyFile + " for connection " + c.Name + ": " + err.Error()
+			// default to port 22
+			host = c.Host
+			c.Host = net.JoinHostPort(c.Host, "22")
 		}
-	} else if c.Key != "" {
-		key = []byte(c.Key)
-	}
-
-	// try to parse key
-	if key != nil {
-		// is there a password for the key?
-		var signer ssh.Signer
-		var err error
-		if c.Password == "" {
-			signer, err = ssh.ParsePrivateKey(key)
-		} else {
-			signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(c.Password))
+		addrs, _ := net.LookupHost(host)
+		if len(addrs) == 0 {
+			return "failed to resolve host " + c.Host + " for connection " + c.Name
 		}
-		if err != nil {
-			return "failed to parse key for connection " + c.Name + ": " + err.Error()
+	case "ws", "wss":
+		u, err := url.Parse(c.Host)
+		if err != nil || u.Host == "" {
+			return "Host is not a valid WebSocket URL for connection " + c.Name
 		}
-		c.auth = ssh.PublicKeys(signer)
+		if u.Scheme == "" {
+			u.Scheme = c.Transport
+			c.Host = u.String()
+		}
+	default:
+		return "Transport must be tcp, ws, or wss, not " + c.Transport + " for connection " + c.Name
 	}
 
-	// if no key is set, try to use password
-	if c.auth == nil && c.Password != "" {
-		c.auth = ssh.Password(c.Password)
+	// build the list of auth methods to try, in order: ssh agent, all
+	// configured keys, password, then keyboard-interactive
+	c.authMethods = nil
+
+	if am, err := c.agentAuthMethod(); err != nil {
+		return "failed to use ssh agent for connection " + c.Name + ": " + err.Error()
+	} else if am != nil {
+		c.authMethods = append(c.authMethods, am)
 	}
 
-	// check tunnels
-	for _, t := range c.Tunnels {
-		if t.From.Side == "" {
-			return c.Name + ".From.Side is empty"
-		}
-		if t.From.Address == "" {
-			return c.Name + ".From.Address is empty"
-		}
-		if t.To.Side == "" {
-			return c.Name + ".To.Side is empty"
+	keys := c.Keys
+	// Password doubles as the legacy KeyFile/Key's passphrase; once
+	// consumed that way, it shouldn't also be tried as a separate
+	// password-auth attempt below.
+	passwordIsKeyPassphrase := c.KeyFile != "" || c.Key != ""
+	if passwordIsKeyPassphrase {
+		keys = append([]KeyConfig{{File: c.KeyFile, Key: c.Key, Password: c.Password}}, keys...)
+	}
+	var signers []ssh.Signer
+	for _, k := range keys {
+		signer, issue := k.parse(c.Name)
+		if issue != "" {
+			return issue
 		}
-		if t.To.Address == "" {
-			return c.Name + ".To.Address is empty"
+		if signer != nil {
+			signers = append(signers, signer)
 		}
+	}
+	if len(signers) > 0 {
+		c.authMethods = append(c.authMethods, ssh.PublicKeys(signers...))
+	}
 
-		// tunnel must have a Local and Remote endpoint
-		if t.From.Side == "Local" && t.To.Side == "Remote" {
-			t.direction = ExposedLocally
-		} else if t.From.Side == "Remote" && t.To.Side == "Local" {
-			t.direction = ExposedOnServer
-		} else {
-			return "for connection " + c.Name + ", tunnel should be Local->Remote or Remote->Local"
-		}
+	if c.Password != "" && !passwordIsKeyPassphrase {
+		c.authMethods = append(c.authMethods, ssh.Password(c.Password))
+	}
 
-		// check that From and To are valid
-		_, fromPort, err := net.SplitHostPort(t.From.Address)
-		if err != nil {
-			return "for connection " + c.Name + ", tunnel From address is invalid: " + err.Error()
-		}
-		if fromPort == "" {
-			return "for connection " + c.Name + ", tunnel From address is missing port number"
-		}
-		_, toPort, err := net.SplitHostPort(t.To.Address)
-		if err != nil {
-			return "for connection " + c.Name + ", tunnel To address is invalid: " + err.Error()
-		}
-		if toPort == "" {
-			return "for connection " + c.Name + ", tunnel To address is missing port number"
+	if len(c.KeyboardInteractive) > 0 {
+		c.authMethods = append(c.authMethods, ssh.KeyboardInteractive(c.keyboardInteractiveChallenge))
+	}
+
+	// check tunnels
+	for _, t := range c.Tunnels {
+		if issue := classifyTunnel(t); issue != "" {
+			return "for connection " + c.Name + ", " + issue
 		}
 	}
 
@@ -256,6 +600,9 @@ func (c *Connection) validate() string {
 }
 
 func (c *Connection) connect() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	if c.conn != nil {
 		c.setStatus("already connected")
 		return true
@@ -269,43 +616,37 @@ func (c *Connection) connect() bool {
 
 	// connect to SSH server
 	c.setStatus("connecting")
-	var authMethods []ssh.AuthMethod
-	if c.auth != nil {
-		authMethods = []ssh.AuthMethod{c.auth}
+	hostKeyCallback, err := c.hostKeyCallback()
+	if err != nil {
+		c.setStatus("failed to set up host key verification: " + err.Error())
+		return false
 	}
-	var err error
-	c.conn, err = ssh.Dial("tcp", c.Host, &ssh.ClientConfig{
-		User:            c.Username,
-		Auth:            authMethods,
-		HostKeyCallback: fingerprintverifier.New(c.Fingerprint),
+
+	transportConn, err := c.dialTransport()
+	if err != nil {
+		c.setStatus("failed to connect to " + c.Host + ": " + err.Error())
+		return false
+	}
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(transportConn, c.Host, &ssh.ClientConfig{
+		User:              c.Username,
+		Auth:              c.authMethods,
+		HostKeyCallback:   hostKeyCallback,
+		HostKeyAlgorithms: c.HostKeyAlgorithms,
 	})
 	if err != nil {
+		transportConn.Close()
 		c.setStatus("failed to connect to " + c.Host + ": " + err.Error())
 		return false
 	}
+	c.conn = ssh.NewClient(sshConn, chans, reqs)
 
 	// establish tunnels
 	c.setStatus("configuring tunnels")
+	c.connectedAt.Store(time.Now())
 	for _, t := range c.Tunnels {
-		switch t.direction {
-		case ExposedLocally:
-			l, err := net.Listen("tcp", t.From.Address)
-			if err != nil {
-				c.setStatus("failed to listen on " + t.From.Address + " (Local): " + err.Error())
-				continue
-			}
-			c.listeners = append(c.listeners, l)
-			go Forward(l, t.To.Address, c.conn.Dial, c.setStatus)
-		case ExposedOnServer:
-			r, err := c.conn.Listen("tcp", t.From.Address)
-			if err != nil {
-				c.setStatus("failed to listen on " + t.From.Address + " (Remote): " + err.Error())
-				continue
-			}
-			c.listeners = append(c.listeners, r)
-			go Forward(r, t.To.Address, net.Dial, c.setStatus)
-		default:
-			panic("invalid tunnel direction")
+		if err := c.startTunnel(t); err != nil {
+			c.setStatus(err.Error())
 		}
 	}
 	c.setStatus("ok")
@@ -313,7 +654,115 @@ func (c *Connection) connect() bool {
 	return true
 }
 
+// startTunnel sets up listening and forwarding for a single tunnel of
+// an already-connected c, used both by connect() and by /reload adding
+// a tunnel to a connection that's staying up. Callers must hold c.mu.
+func (c *Connection) startTunnel(t *Tunnel) error {
+	switch t.direction {
+	case ExposedLocally:
+		l, err := listenLocal(t.From)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s (Local): %w", t.From.Address, err)
+		}
+		t.listener = l
+		c.listeners = append(c.listeners, l)
+		go Forward(l, t.To, c.conn.Dial, c.setStatus, t)
+	case ExposedOnServer:
+		// t.From.Network is already normalized to "tcp" or "unix" by
+		// classifyTunnel/Endpoint.validate; ssh.Client.Listen handles both.
+		r, err := c.conn.Listen(t.From.Network, t.From.Address)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s (Remote): %w", t.From.Address, err)
+		}
+		t.listener = r
+		c.listeners = append(c.listeners, r)
+		go Forward(r, t.To, net.Dial, c.setStatus, t)
+	case Dynamic:
+		l, err := listenLocal(t.From)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s (Local): %w", t.From.Address, err)
+		}
+		t.listener = l
+		c.listeners = append(c.listeners, l)
+		go ServeSOCKS(l, c.conn.Dial, t.Allow, t.Deny, c.setStatus, t)
+	default:
+		panic("invalid tunnel direction")
+	}
+	return nil
+}
+
+// stopTunnel closes a single tunnel's listener, used by /reload to drop
+// a tunnel that's been removed from a connection that's staying up.
+func (t *Tunnel) stopTunnel() {
+	if t.listener != nil {
+		t.listener.Close()
+	}
+}
+
+// tunnelKey identifies a tunnel by its endpoints, for matching tunnels
+// across a /reload without disturbing ones that didn't change.
+func tunnelKey(t *Tunnel) string {
+	return fmt.Sprintf(
+		"%s %s %s -> %s %s %s",
+		t.From.Side, t.From.Network, t.From.Address,
+		t.To.Side, t.To.Network, t.To.Address,
+	)
+}
+
+// reloadTunnels replaces c.Tunnels with wanted, starting any new
+// tunnels and stopping any removed ones, but leaving tunnels that exist
+// in both (matched by tunnelKey) alone, listener and stats included.
+func (c *Connection) reloadTunnels(wanted []*Tunnel) error {
+	for _, w := range wanted {
+		if issue := classifyTunnel(w); issue != "" {
+			return fmt.Errorf("%s", issue)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		// not currently connected; the next connect() will start
+		// whatever's in c.Tunnels from scratch
+		c.Tunnels = wanted
+		return nil
+	}
+
+	existing := make(map[string]*Tunnel, len(c.Tunnels))
+	for _, t := range c.Tunnels {
+		existing[tunnelKey(t)] = t
+	}
+
+	newTunnels := make([]*Tunnel, 0, len(wanted))
+	keep := make(map[string]bool, len(wanted))
+	for _, w := range wanted {
+		key := tunnelKey(w)
+		keep[key] = true
+		if t, ok := existing[key]; ok {
+			newTunnels = append(newTunnels, t)
+			continue
+		}
+		if err := c.startTunnel(w); err != nil {
+			return err
+		}
+		newTunnels = append(newTunnels, w)
+	}
+
+	for key, t := range existing {
+		if !keep[key] {
+			t.stopTunnel()
+		}
+	}
+
+	c.Tunnels = newTunnels
+	return nil
+}
+
 func (c *Connection) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	if c.conn != nil {
 		go c.conn.Close()
 	}
@@ -326,7 +775,10 @@ func (c *Connection) Close() error {
 }
 
 func (c *Connection) IsAlive(timeout time.Duration) bool {
-	if c.conn == nil {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn == nil {
 		return false
 	}
 
@@ -335,7 +787,7 @@ func (c *Connection) IsAlive(timeout time.Duration) bool {
 
 	errChan := make(chan error)
 	go func() {
-		_, _, err := c.conn.SendRequest("keepalive@openssh.com", true, nil)
+		_, _, err := conn.SendRequest("keepalive@openssh.com", true, nil)
 		errChan <- err
 	}()
 
@@ -354,12 +806,29 @@ func Handle(c *Connection) {
 	c.reconnectDelay = time.Second
 
 	for {
+		select {
+		case <-c.done:
+			c.Close()
+			c.setStatus("removed")
+			return
+		default:
+		}
+
 		if c.IsAlive(kii / 10 * 9) {
 			c.reconnectDelay = time.Second
-			<-t.C
-			continue
+			select {
+			case <-t.C:
+				continue
+			case <-c.forceReconnect:
+				c.setStatus("reconnect requested")
+			case <-c.done:
+				c.Close()
+				c.setStatus("removed")
+				return
+			}
+		} else {
+			c.setStatus("disconnected")
 		}
-		c.setStatus("disconnected")
 
 		// reconnect
 		c.Close()
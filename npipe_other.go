@@ -0,0 +1,14 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"net"
+)
+
+// listenNamedPipe is only implemented on Windows; named pipes have no
+// equivalent on other platforms.
+func listenNamedPipe(path string, mode string) (net.Listener, error) {
+	return nil, fmt.Errorf("npipe endpoints are only supported on windows")
+}
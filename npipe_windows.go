@@ -0,0 +1,16 @@
+//go:build windows
+
+package main
+
+import (
+	"net"
+
+	"github.com/Microsoft/go-winio"
+)
+
+// listenNamedPipe listens on a Windows named pipe (e.g. \\.\pipe\tuntun).
+// Mode is not currently translated into a pipe security descriptor; the
+// pipe is created with go-winio's default (current user only) ACL.
+func listenNamedPipe(path string, mode string) (net.Listener, error) {
+	return winio.ListenPipe(path, nil)
+}
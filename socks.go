@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"strconv"
+)
+
+// SOCKS5 protocol constants (RFC 1928).
+const (
+	socks5Version = 0x05
+
+	socks5AuthNone         = 0x00
+	socks5AuthNoAcceptable = 0xFF
+
+	socks5CmdConnect      = 0x01
+	socks5CmdBind         = 0x02
+	socks5CmdUDPAssociate = 0x03
+
+	socks5AtypIPv4   = 0x01
+	socks5AtypDomain = 0x03
+	socks5AtypIPv6   = 0x04
+
+	socks5RepSucceeded           = 0x00
+	socks5RepGeneralFailure      = 0x01
+	socks5RepConnRefused         = 0x05
+	socks5RepCommandNotSupported = 0x07
+)
+
+// ServeSOCKS accepts connections from l and serves each as a SOCKS5
+// proxy, dialing the client's requested destination with with. Only the
+// CONNECT command is supported; BIND and UDP ASSOCIATE are rejected with
+// "command not supported". If allow is non-empty, a destination
+// ("host:port") must match one of its patterns (as per path.Match) to be
+// permitted; deny patterns are checked first and always win.
+func ServeSOCKS(l net.Listener, with DialFunc, allow, deny []string, log LogFunc, t *Tunnel) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			log("error listening on " + l.Addr().String() + ": " + err.Error())
+			return
+		}
+		t.activeConns.Add(1)
+		go func() {
+			if err := handleSOCKSConn(conn, with, allow, deny, t); err != nil {
+				t.activeConns.Add(-1)
+				log("socks: " + err.Error())
+			}
+		}()
+	}
+}
+
+func handleSOCKSConn(conn net.Conn, with DialFunc, allow, deny []string, t *Tunnel) error {
+	if err := socksNegotiateAuth(conn); err != nil {
+		conn.Close()
+		return fmt.Errorf("auth negotiation with %s failed: %w", conn.RemoteAddr(), err)
+	}
+
+	target, cmd, err := socksReadRequest(conn)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("request from %s failed: %w", conn.RemoteAddr(), err)
+	}
+
+	if cmd != socks5CmdConnect {
+		socksReply(conn, socks5RepCommandNotSupported)
+		conn.Close()
+		return fmt.Errorf("%s requested unsupported SOCKS command %d", conn.RemoteAddr(), cmd)
+	}
+
+	if !socksAllowed(target, allow, deny) {
+		socksReply(conn, socks5RepConnRefused)
+		conn.Close()
+		return fmt.Errorf("destination %s denied by Allow/Deny rules", target)
+	}
+
+	toConn, err := with("tcp", target)
+	if err != nil {
+		socksReply(conn, socks5RepGeneralFailure)
+		conn.Close()
+		return fmt.Errorf("failed to connect to %s: %w", target, err)
+	}
+
+	if err := socksReply(conn, socks5RepSucceeded); err != nil {
+		conn.Close()
+		toConn.Close()
+		return err
+	}
+
+	// ConnectConns takes ownership of both connections and closes them
+	// once either side's copy loop ends; activeConns is decremented via
+	// OnClose rather than here, since the proxying is only now starting.
+	ConnectConns(conn, toConn, &ConnStats{
+		BytesUp:   &t.bytesFromClient,
+		BytesDown: &t.bytesToClient,
+		OnClose:   func() { t.activeConns.Add(-1) },
+	})
+	return nil
+}
+
+// socksNegotiateAuth reads the client's method negotiation and selects
+// "no authentication required", the only method tuntun offers.
+func socksNegotiateAuth(conn net.Conn) error {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	if header[0] != socks5Version {
+		return fmt.Errorf("unsupported SOCKS version %d", header[0])
+	}
+
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return err
+	}
+
+	for _, m := range methods {
+		if m == socks5AuthNone {
+			_, err := conn.Write([]byte{socks5Version, socks5AuthNone})
+			return err
+		}
+	}
+
+	conn.Write([]byte{socks5Version, socks5AuthNoAcceptable})
+	return fmt.Errorf("client offered no acceptable auth method")
+}
+
+// socksReadRequest reads a SOCKS5 request and returns the requested
+// command and "host:port" destination.
+func socksReadRequest(conn net.Conn) (target string, cmd byte, err error) {
+	header := make([]byte, 4)
+	if _, err = io.ReadFull(conn, header); err != nil {
+		return "", 0, err
+	}
+	if header[0] != socks5Version {
+		return "", 0, fmt.Errorf("unsupported SOCKS version %d", header[0])
+	}
+	cmd = header[1]
+
+	var host string
+	switch header[3] {
+	case socks5AtypIPv4:
+		addr := make([]byte, 4)
+		if _, err = io.ReadFull(conn, addr); err != nil {
+			return "", 0, err
+		}
+		host = net.IP(addr).String()
+	case socks5AtypIPv6:
+		addr := make([]byte, 16)
+		if _, err = io.ReadFull(conn, addr); err != nil {
+			return "", 0, err
+		}
+		host = net.IP(addr).String()
+	case socks5AtypDomain:
+		length := make([]byte, 1)
+		if _, err = io.ReadFull(conn, length); err != nil {
+			return "", 0, err
+		}
+		domain := make([]byte, length[0])
+		if _, err = io.ReadFull(conn, domain); err != nil {
+			return "", 0, err
+		}
+		host = string(domain)
+	default:
+		return "", 0, fmt.Errorf("unsupported address type %d", header[3])
+	}
+
+	portBytes := make([]byte, 2)
+	if _, err = io.ReadFull(conn, portBytes); err != nil {
+		return "", 0, err
+	}
+	port := binary.BigEndian.Uint16(portBytes)
+
+	return net.JoinHostPort(host, strconv.Itoa(int(port))), cmd, nil
+}
+
+// socksReply writes a SOCKS5 reply with the given status, and a bound
+// address of 0.0.0.0:0 (tuntun doesn't expose the actual dialed local
+// address to the client).
+func socksReply(conn net.Conn, rep byte) error {
+	reply := []byte{
+		socks5Version, rep, 0x00, socks5AtypIPv4,
+		0, 0, 0, 0, // address
+		0, 0, // port
+	}
+	_, err := conn.Write(reply)
+	return err
+}
+
+// socksAllowed reports whether target ("host:port") may be dialed,
+// given allow/deny glob patterns matched with path.Match. deny is
+// checked first and always wins; if allow is non-empty, target must
+// also match one of its patterns.
+func socksAllowed(target string, allow, deny []string) bool {
+	for _, pattern := range deny {
+		if ok, _ := path.Match(pattern, target); ok {
+			return false
+		}
+	}
+
+	if len(allow) == 0 {
+		return true
+	}
+	for _, pattern := range allow {
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+	}
+	return false
+}
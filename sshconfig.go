@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// configFile is the alternate top-level config shape: an object instead
+// of a bare JSON array of Connections, which can list Connections
+// directly, import them from one or more OpenSSH client config files
+// (optionally restricted to aliases matching Only), and/or set
+// top-level options such as ControlListen.
+type configFile struct {
+	Connections   []*Connection
+	Import        []string
+	Only          []string
+	ControlListen string
+}
+
+// parsedConfig is the result of parsing a tuntun config file, whichever
+// of the two shapes it used.
+type parsedConfig struct {
+	Connections   []*Connection
+	ControlListen string
+}
+
+// parseConfigFile parses the config file contents j, which is either a
+// plain JSON array of Connections (the original shape) or a configFile
+// object.
+func parseConfigFile(j []byte) (*parsedConfig, error) {
+	var cf configFile
+	if err := json.Unmarshal(j, &cf); err == nil &&
+		(len(cf.Import) > 0 || len(cf.Connections) > 0 || cf.ControlListen != "") {
+		connections := append([]*Connection{}, cf.Connections...)
+		for _, importPath := range cf.Import {
+			imported, err := ImportSSHConfig(expandHome(importPath), cf.Only)
+			if err != nil {
+				return nil, fmt.Errorf("failed to import %s: %w", importPath, err)
+			}
+			connections = append(connections, imported...)
+		}
+		return &parsedConfig{Connections: connections, ControlListen: cf.ControlListen}, nil
+	}
+
+	var connections []*Connection
+	if err := json.Unmarshal(j, &connections); err != nil {
+		return nil, err
+	}
+	return &parsedConfig{Connections: connections}, nil
+}
+
+// sshHost is one Host block parsed out of an OpenSSH client config
+// file. Only the directives tuntun understands are recorded.
+type sshHost struct {
+	patterns        []string
+	hostName        string
+	user            string
+	port            string
+	identityFiles   []string
+	localForwards   []string
+	remoteForwards  []string
+	dynamicForwards []string
+	knownHostsFile  string
+	proxyJump       string
+}
+
+// ImportSSHConfig reads the OpenSSH client config file at path and
+// returns one Connection per Host block that has an unambiguous alias
+// (no glob patterns) and at least one *Forward directive. If only is
+// non-empty, a Host block is imported only if one of its aliases
+// matches one of the only glob patterns (as per path.Match). Host
+// blocks this can't represent (any alias with a wildcard, ProxyJump, no
+// forwards) are skipped with a log message rather than failing the
+// whole import.
+func ImportSSHConfig(path string, only []string) ([]*Connection, error) {
+	hosts, err := parseSSHConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var connections []*Connection
+	for _, h := range hosts {
+		if !sshHostMatchesOnly(h, only) {
+			continue
+		}
+
+		c, skipReason := h.toConnection()
+		if skipReason != "" {
+			log.Println("tuntun: skipping ssh config host \"" + strings.Join(h.patterns, " ") + "\": " + skipReason)
+			continue
+		}
+		connections = append(connections, c)
+	}
+
+	return connections, nil
+}
+
+func sshHostMatchesOnly(h *sshHost, only []string) bool {
+	if len(only) == 0 {
+		return true
+	}
+	for _, alias := range h.patterns {
+		for _, pattern := range only {
+			if ok, _ := path.Match(pattern, alias); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// toConnection converts h into a Connection, or returns a reason it
+// can't be (not an error: the rest of the import should still proceed).
+func (h *sshHost) toConnection() (c *Connection, skipReason string) {
+	if len(h.patterns) == 0 {
+		return nil, "no Host aliases"
+	}
+	for _, p := range h.patterns {
+		if strings.ContainsAny(p, "*?") {
+			return nil, "Host is a wildcard pattern, not an alias for a specific server"
+		}
+	}
+	if h.proxyJump != "" {
+		return nil, "ProxyJump is not supported"
+	}
+
+	hostName := h.hostName
+	if hostName == "" {
+		hostName = h.patterns[0]
+	}
+	port := h.port
+	if port == "" {
+		port = "22"
+	}
+
+	c = &Connection{
+		Name:     h.patterns[0],
+		Host:     net.JoinHostPort(hostName, port),
+		Username: h.user,
+	}
+
+	if len(h.identityFiles) > 0 {
+		c.KeyFile = h.identityFiles[0]
+		for _, file := range h.identityFiles[1:] {
+			c.Keys = append(c.Keys, KeyConfig{File: file})
+		}
+	}
+	// imported hosts default to the user's own known_hosts, like ssh
+	// itself, rather than tuntun's own (see Connection.validate)
+	if h.knownHostsFile != "" {
+		c.KnownHostsFile = h.knownHostsFile
+	} else {
+		c.KnownHostsFile = expandHome("~/.ssh/known_hosts")
+	}
+
+	for _, spec := range h.localForwards {
+		t, err := parseForwardSpec(spec, ExposedLocally)
+		if err != nil {
+			return nil, "invalid LocalForward " + spec + ": " + err.Error()
+		}
+		c.Tunnels = append(c.Tunnels, t)
+	}
+	for _, spec := range h.remoteForwards {
+		t, err := parseForwardSpec(spec, ExposedOnServer)
+		if err != nil {
+			return nil, "invalid RemoteForward " + spec + ": " + err.Error()
+		}
+		c.Tunnels = append(c.Tunnels, t)
+	}
+	for _, spec := range h.dynamicForwards {
+		t, err := parseDynamicForwardSpec(spec)
+		if err != nil {
+			return nil, "invalid DynamicForward " + spec + ": " + err.Error()
+		}
+		c.Tunnels = append(c.Tunnels, t)
+	}
+
+	if len(c.Tunnels) == 0 {
+		return nil, "no LocalForward, RemoteForward, or DynamicForward directives"
+	}
+
+	return c, ""
+}
+
+// parseForwardSpec parses the argument of a LocalForward or
+// RemoteForward directive ("bind_spec host_spec") into a Tunnel with
+// the given direction.
+func parseForwardSpec(spec string, direction TunnelDirection) (*Tunnel, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("expected \"bind_spec host_spec\", got %q", spec)
+	}
+
+	bind := normalizeForwardAddress(fields[0])
+	host := normalizeForwardAddress(fields[1])
+
+	t := &Tunnel{direction: direction}
+	if direction == ExposedLocally {
+		bind.Side, host.Side = "Local", "Remote"
+		t.From, t.To = bind, host
+	} else {
+		bind.Side, host.Side = "Remote", "Local"
+		t.From, t.To = bind, host
+	}
+	return t, nil
+}
+
+// parseDynamicForwardSpec parses the argument of a DynamicForward
+// directive (a single bind address or port) into a Dynamic (SOCKS5)
+// Tunnel.
+func parseDynamicForwardSpec(spec string) (*Tunnel, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 1 {
+		return nil, fmt.Errorf("expected a single bind address or port, got %q", spec)
+	}
+
+	bind := normalizeForwardAddress(fields[0])
+	bind.Side = "Local"
+
+	return &Tunnel{
+		direction: Dynamic,
+		From:      bind,
+		To:        Endpoint{Side: "Remote", Address: dynamicToAddress},
+	}, nil
+}
+
+// normalizeForwardAddress turns one token of a *Forward directive into
+// an Endpoint: a filesystem path becomes a unix socket, a bare port
+// number is bound on 127.0.0.1, and anything else is used as-is.
+func normalizeForwardAddress(token string) Endpoint {
+	if strings.HasPrefix(token, "/") {
+		return Endpoint{Network: "unix", Address: token}
+	}
+	if _, err := strconv.Atoi(token); err == nil {
+		return Endpoint{Network: "tcp", Address: "127.0.0.1:" + token}
+	}
+	return Endpoint{Network: "tcp", Address: token}
+}
+
+// parseSSHConfig reads an OpenSSH client config file and returns one
+// sshHost per Host block, in file order. Include/Match directives and
+// cascading of options across blocks are not supported; each Host block
+// is self-contained.
+func parseSSHConfig(path string) ([]*sshHost, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var hosts []*sshHost
+	var current *sshHost
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		keyword, value, ok := splitSSHConfigLine(line)
+		if !ok {
+			continue
+		}
+
+		if strings.EqualFold(keyword, "Host") {
+			current = &sshHost{patterns: strings.Fields(value)}
+			hosts = append(hosts, current)
+			continue
+		}
+		if current == nil {
+			continue
+		}
+
+		switch strings.ToLower(keyword) {
+		case "hostname":
+			current.hostName = value
+		case "user":
+			current.user = value
+		case "port":
+			current.port = value
+		case "identityfile":
+			current.identityFiles = append(current.identityFiles, expandHome(value))
+		case "localforward":
+			current.localForwards = append(current.localForwards, value)
+		case "remoteforward":
+			current.remoteForwards = append(current.remoteForwards, value)
+		case "dynamicforward":
+			current.dynamicForwards = append(current.dynamicForwards, value)
+		case "userknownhostsfile":
+			current.knownHostsFile = expandHome(value)
+		case "proxyjump":
+			current.proxyJump = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return hosts, nil
+}
+
+// splitSSHConfigLine splits a config line into its keyword and value,
+// accepting either "Keyword value" or "Keyword=value" form.
+func splitSSHConfigLine(line string) (keyword, value string, ok bool) {
+	i := strings.IndexFunc(line, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '='
+	})
+	if i < 0 {
+		return "", "", false
+	}
+	keyword = line[:i]
+	value = strings.Trim(strings.TrimLeft(line[i:], " \t="), `"`)
+	return keyword, value, true
+}
+
+// expandHome replaces a leading "~" in path with the current user's
+// home directory.
+func expandHome(path string) string {
+	if path == "~" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return path
+		}
+		return home
+	}
+	if strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return path
+		}
+		return filepath.Join(home, path[2:])
+	}
+	return path
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// listenLocal opens a Local listener for e, dispatching to net.Listen,
+// a unix socket listener, or (on Windows) a named pipe listener
+// depending on e.Network.
+func listenLocal(e Endpoint) (net.Listener, error) {
+	switch e.Network {
+	case "unix":
+		return listenUnix(e.Address, e.Mode)
+	case "npipe":
+		return listenNamedPipe(e.Address, e.Mode)
+	default:
+		return net.Listen("tcp", e.Address)
+	}
+}
+
+// listenUnix removes any stale socket file left over from an unclean
+// shutdown, listens on the given path, and chmods it if mode is set.
+func listenUnix(path string, mode string) (net.Listener, error) {
+	os.Remove(path)
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if mode != "" {
+		perm, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil {
+			l.Close()
+			return nil, fmt.Errorf("invalid Mode %q: %w", mode, err)
+		}
+		if err := os.Chmod(path, os.FileMode(perm)); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+
+	return l, nil
+}
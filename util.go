@@ -10,34 +10,72 @@ import (
 	"path/filepath"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Pipe struct {
-	conn1  net.Conn
-	conn2  net.Conn
-	close1 sync.Once
-	close2 sync.Once
+	conn1   net.Conn
+	conn2   net.Conn
+	close1  sync.Once
+	close2  sync.Once
+	onClose func()
+	closed  sync.Once
 }
 
-func ConnectConns(conn1, conn2 net.Conn) *Pipe {
+// ConnStats, if passed to ConnectConns, is updated as bytes flow and
+// notified once the pipe closes, for the control API's per-tunnel
+// byte/connection counters.
+type ConnStats struct {
+	BytesUp   *atomic.Int64 // conn1 -> conn2
+	BytesDown *atomic.Int64 // conn2 -> conn1
+	OnClose   func()
+}
+
+func ConnectConns(conn1, conn2 net.Conn, stats *ConnStats) *Pipe {
 	log.Printf(
 		"Connecting %s <-> %s",
 		conn1.RemoteAddr().String(),
 		conn2.RemoteAddr().String(),
 	)
 	p := &Pipe{conn1: conn1, conn2: conn2}
+
+	var up, down *atomic.Int64
+	if stats != nil {
+		up, down = stats.BytesUp, stats.BytesDown
+		p.onClose = stats.OnClose
+	}
+
 	go func() {
-		io.Copy(conn2, conn1)
+		copyCounting(conn2, conn1, up)
 		p.Close()
 	}()
 	go func() {
-		io.Copy(conn1, conn2)
+		copyCounting(conn1, conn2, down)
 		p.Close()
 	}()
 	return p
 }
 
+// copyCounting is io.Copy, optionally also tallying bytes copied into
+// counter.
+func copyCounting(dst io.Writer, src io.Reader, counter *atomic.Int64) {
+	if counter == nil {
+		io.Copy(dst, src)
+		return
+	}
+	io.Copy(io.MultiWriter(dst, &countingWriter{counter}), src)
+}
+
+type countingWriter struct {
+	counter *atomic.Int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.counter.Add(int64(len(p)))
+	return len(p), nil
+}
+
 func (p *Pipe) Close() error {
 	var err1, err2 error
 	p.close1.Do(func() {
@@ -46,6 +84,11 @@ func (p *Pipe) Close() error {
 	p.close2.Do(func() {
 		err2 = p.conn2.Close()
 	})
+	p.closed.Do(func() {
+		if p.onClose != nil {
+			p.onClose()
+		}
+	})
 	if err1 != nil {
 		return err1
 	}
@@ -58,21 +101,31 @@ func (p *Pipe) Close() error {
 type DialFunc func(network, addr string) (net.Conn, error)
 type LogFunc func(string)
 
-func Forward(from net.Listener, to string, with DialFunc, log LogFunc) {
+func Forward(from net.Listener, to Endpoint, with DialFunc, log LogFunc, t *Tunnel) {
+	network := to.Network
+	if network == "" {
+		network = "tcp"
+	}
 	for {
 		conn, err := from.Accept()
 		if err != nil {
 			log("error listening on " + from.Addr().String() + ": " + err.Error())
 			return
 		}
+		t.activeConns.Add(1)
 		go func() {
-			toConn, err := with("tcp", to)
+			toConn, err := with(network, to.Address)
 			if err != nil {
 				conn.Close()
-				log("failed to connect to " + to + ": " + err.Error())
+				t.activeConns.Add(-1)
+				log("failed to connect to " + to.Address + ": " + err.Error())
 				return
 			}
-			ConnectConns(conn, toConn)
+			ConnectConns(conn, toConn, &ConnStats{
+				BytesUp:   &t.bytesFromClient,
+				BytesDown: &t.bytesToClient,
+				OnClose:   func() { t.activeConns.Add(-1) },
+			})
 		}()
 	}
 }
@@ -177,10 +230,14 @@ var sampleConfig = []Connection{
 			},
 		},
 	}, {
-		Name:     "Something I Want To Expose To My LOCAL Network",
-		Host:     "gateway-server.example.com:22",
-		Username: "root",
-		Key:      sampleSSHKey,
+		Name: "Something I Want To Expose To My LOCAL Network",
+		Host: "gateway-server.example.com:22",
+		// TrustOnFirstUse is required here since this entry has no
+		// Fingerprint/Fingerprints: without one of the three, tuntun
+		// refuses to connect rather than trust a server's key blindly.
+		TrustOnFirstUse: true,
+		Username:        "root",
+		Key:             sampleSSHKey,
 		Tunnels: []*Tunnel{
 			{
 				From: Endpoint{
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialTransport opens the byte stream c's SSH handshake will run over,
+// according to c.Transport.
+func (c *Connection) dialTransport() (net.Conn, error) {
+	switch c.Transport {
+	case "", "tcp":
+		return net.Dial("tcp", c.Host)
+	case "ws", "wss":
+		return dialWebsocket(c.Host)
+	default:
+		return nil, fmt.Errorf("unknown Transport %q", c.Transport)
+	}
+}
+
+// dialWebsocket dials a ws:// or wss:// URL and wraps the resulting
+// WebSocket connection as a net.Conn carrying binary messages as a byte
+// stream, suitable for ssh.NewClientConn. It honors HTTP_PROXY/
+// HTTPS_PROXY, like websocket.DefaultDialer.
+func dialWebsocket(wsURL string) (net.Conn, error) {
+	dialer := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: 45 * time.Second,
+	}
+	wsConn, _, err := dialer.Dial(wsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return newWSConn(wsConn), nil
+}
+
+// wsConn adapts a *websocket.Conn (message-oriented) into a net.Conn
+// (stream-oriented): writes become one binary message each, and reads
+// transparently move on to the next message once the current one is
+// exhausted.
+type wsConn struct {
+	*websocket.Conn
+	reader io.Reader
+}
+
+func newWSConn(c *websocket.Conn) *wsConn {
+	return &wsConn{Conn: c}
+}
+
+func (c *wsConn) Read(p []byte) (int, error) {
+	for {
+		if c.reader == nil {
+			_, r, err := c.Conn.NextReader()
+			if err != nil {
+				return 0, err
+			}
+			c.reader = r
+		}
+
+		n, err := c.reader.Read(p)
+		if err == io.EOF {
+			c.reader = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (c *wsConn) Write(p []byte) (int, error) {
+	if err := c.Conn.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *wsConn) SetDeadline(t time.Time) error {
+	if err := c.Conn.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.Conn.SetWriteDeadline(t)
+}
+
+// runServeWS implements the "tuntun serve-ws" subcommand: it upgrades
+// incoming WebSocket connections and proxies the byte stream to a local
+// (or at least TCP-reachable) SSH server, so the SSH server itself
+// doesn't need to know anything about WebSockets.
+func runServeWS(args []string) {
+	fs := flag.NewFlagSet("serve-ws", flag.ExitOnError)
+	listen := fs.String("listen", "0.0.0.0:8443", "address to listen on for incoming WebSocket connections")
+	upstream := fs.String("upstream", "", "address of the SSH server to proxy connections to")
+	fs.Parse(args)
+
+	if *upstream == "" {
+		fmt.Fprintln(os.Stderr, "serve-ws: --upstream is required")
+		os.Exit(1)
+	}
+
+	log.Println("serve-ws: listening on " + *listen + ", proxying to " + *upstream)
+	err := http.ListenAndServe(*listen, wsUpstreamHandler(*upstream))
+	if err != nil {
+		panic(err)
+	}
+}
+
+func wsUpstreamHandler(upstream string) http.Handler {
+	upgrader := websocket.Upgrader{
+		// this is a transport for an already-authenticated SSH
+		// handshake, not a browser-facing API; any origin is fine
+		CheckOrigin: func(r *http.Request) bool { return true },
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Println("serve-ws: upgrade from " + r.RemoteAddr + " failed: " + err.Error())
+			return
+		}
+
+		upstreamConn, err := net.Dial("tcp", upstream)
+		if err != nil {
+			log.Println("serve-ws: failed to connect to upstream " + upstream + ": " + err.Error())
+			client.Close()
+			return
+		}
+
+		ConnectConns(newWSConn(client), upstreamConn, nil)
+	})
+}